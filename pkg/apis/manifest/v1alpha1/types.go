@@ -0,0 +1,121 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package v1alpha1 holds the Manifest resource, kinflate's description of how to build a set of
+// Kubernetes objects from a base plus an overlay directory.
+package v1alpha1
+
+// Manifest is the go representation of a `Kube-manifest.yaml` file.
+type Manifest struct {
+	// NamePrefix will prefix the names of all resources mentioned in the Manifest file
+	// including generated configmaps and secrets.
+	NamePrefix string `json:"namePrefix,omitempty" yaml:"namePrefix,omitempty"`
+
+	// ObjectLabels are labels to add to all objects.
+	ObjectLabels map[string]string `json:"objectLabels,omitempty" yaml:"objectLabels,omitempty"`
+
+	// ObjectAnnotations are annotations to add to all objects.
+	ObjectAnnotations map[string]string `json:"objectAnnotations,omitempty" yaml:"objectAnnotations,omitempty"`
+
+	// Resources are relative paths to files that contain k8s resources, or to directories
+	// that themselves hold a Kube-manifest.yaml (bases).
+	Resources []string `json:"resources,omitempty"`
+
+	// Patches are relative paths to files that contain strategic merge patches.
+	Patches []string `json:"patches,omitempty"`
+
+	// Recursive indicates whether we should look for manifests recursively in the folder.
+	Recursive bool `json:"recursive,omitempty"`
+
+	// SecretGenerators defines a list of secrets to generate from local files or literals.
+	SecretGenerators []SecretGenerator `json:"secretGenerators,omitempty" yaml:"secretGenerators,omitempty"`
+
+	// ConfigMapGenerators defines a list of configmaps to generate from local files or literals.
+	ConfigMapGenerators []ConfigMapGenerator `json:"configMapGenerators,omitempty" yaml:"configMapGenerators,omitempty"`
+
+	// Clusters declares per-cluster overlay targets, each producing its own deterministic
+	// manifest stream from this same overlay directory.
+	Clusters []ClusterTarget `json:"clusters,omitempty"`
+}
+
+// ClusterTarget describes how to render this overlay for one specific cluster: which context to
+// talk to it through, what additional patches and metadata to layer on, and which of the
+// rendered objects it actually wants.
+type ClusterTarget struct {
+	// Name identifies this cluster target; LoadForCluster selects a target by this name.
+	Name string `json:"name,omitempty"`
+
+	// Context is the kubeconfig context used to reach this cluster.
+	Context string `json:"context,omitempty"`
+
+	// Namespace, if set, is stamped onto every object rendered for this cluster.
+	Namespace string `json:"namespace,omitempty"`
+
+	// Patches are additional strategic merge patches, relative to the overlay directory,
+	// applied on top of the overlay's own patches for this cluster only.
+	Patches []string `json:"patches,omitempty"`
+
+	// ObjectLabels are additional labels applied on top of the overlay's ObjectLabels for this
+	// cluster only.
+	ObjectLabels map[string]string `json:"objectLabels,omitempty" yaml:"objectLabels,omitempty"`
+
+	// ResourceFilter, if set, restricts the objects rendered for this cluster to those matching
+	// it. A nil ResourceFilter matches everything.
+	ResourceFilter *ResourceFilter `json:"resourceFilter,omitempty" yaml:"resourceFilter,omitempty"`
+}
+
+// ResourceFilter selects objects by GroupVersionKind and/or label. An empty field within the
+// filter is treated as "match anything" for that dimension.
+type ResourceFilter struct {
+	// GroupVersionKinds restricts matches to objects whose `apiVersion/kind` appears here, e.g.
+	// "apps/v1/Deployment" or "v1/ConfigMap".
+	GroupVersionKinds []string `json:"groupVersionKinds,omitempty" yaml:"groupVersionKinds,omitempty"`
+
+	// MatchLabels restricts matches to objects carrying all of these labels.
+	MatchLabels map[string]string `json:"matchLabels,omitempty" yaml:"matchLabels,omitempty"`
+}
+
+// GeneratorArgs holds the common fields shared by SecretGenerator and ConfigMapGenerator: the
+// generated object's name, and where its Data comes from.
+type GeneratorArgs struct {
+	// Name of the generated resource, before namePrefix and the content hash are applied.
+	Name string `json:"name,omitempty"`
+
+	// FileSources is a list of files whose content is added to the generated resource. Each
+	// entry is either a bare path (the key is the file's base name), or `key=path`.
+	FileSources []string `json:"files,omitempty" yaml:"files,omitempty"`
+
+	// EnvFileSources is a list of files containing `KEY=VALUE` pairs, one per line, that are
+	// merged into the generated resource's data.
+	EnvFileSources []string `json:"envFiles,omitempty" yaml:"envFiles,omitempty"`
+
+	// LiteralSources is a list of `KEY=VALUE` pairs to add directly to the generated resource's
+	// data.
+	LiteralSources []string `json:"literals,omitempty" yaml:"literals,omitempty"`
+}
+
+// SecretGenerator describes a Secret to generate from files and/or literals.
+type SecretGenerator struct {
+	GeneratorArgs `json:",inline" yaml:",inline"`
+
+	// Type is the Secret's type, e.g. `Opaque` or `kubernetes.io/tls`. Defaults to `Opaque`.
+	Type string `json:"type,omitempty"`
+}
+
+// ConfigMapGenerator describes a ConfigMap to generate from files and/or literals.
+type ConfigMapGenerator struct {
+	GeneratorArgs `json:",inline" yaml:",inline"`
+}
@@ -0,0 +1,167 @@
+package test
+
+import (
+	"fmt"
+	"io"
+	"os/exec"
+	"time"
+
+	"github.com/onsi/gomega/gbytes"
+	"github.com/onsi/gomega/gexec"
+)
+
+// APIServer knows how to run a kube-apiserver binary against an already running Etcd.
+//
+// The documentation and examples for the APIServer's properties can be found in
+// the documentation for `Etcd`, as both implement a `ControlPlaneProcess`.
+type APIServer struct {
+	AddressManager AddressManager
+	Path           string
+	EtcdURL        string
+	ProcessStarter SimpleSessionStarter
+	CertDirManager DataDirManager
+	StopTimeout    time.Duration
+	StartTimeout   time.Duration
+
+	// OIDC, if set, stands up an in-process OIDC issuer and configures this apiserver to
+	// validate bearer tokens against it instead of requiring an external identity provider.
+	OIDC *OIDCOptions
+
+	session    SimpleSession
+	stdOut     *gbytes.Buffer
+	stdErr     *gbytes.Buffer
+	oidcIssuer *oidcIssuer
+}
+
+// URL returns the URL the APIServer is listening on. Clients can use this to connect to it.
+func (s *APIServer) URL() (string, error) {
+	if s.AddressManager == nil {
+		return "", fmt.Errorf("APIServer's AddressManager is not initialized")
+	}
+	port, err := s.AddressManager.Port()
+	if err != nil {
+		return "", err
+	}
+	host, err := s.AddressManager.Host()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("https://%s:%d", host, port), nil
+}
+
+// Start starts the apiserver, waits for it to come up, and returns an error, if occoured.
+func (s *APIServer) Start() error {
+	s.ensureInitialized()
+
+	port, host, err := s.AddressManager.Initialize()
+	if err != nil {
+		return err
+	}
+
+	certDir, err := s.CertDirManager.Create()
+	if err != nil {
+		return err
+	}
+
+	args := []string{
+		fmt.Sprintf("--etcd-servers=%s", s.EtcdURL),
+		fmt.Sprintf("--bind-address=%s", host),
+		fmt.Sprintf("--secure-port=%d", port),
+		fmt.Sprintf("--cert-dir=%s", certDir),
+		"--service-cluster-ip-range=10.0.0.0/24",
+	}
+
+	if s.OIDC != nil {
+		issuer, err := newOIDCIssuer(*s.OIDC)
+		if err != nil {
+			return fmt.Errorf("starting OIDC issuer: %v", err)
+		}
+		s.oidcIssuer = issuer
+
+		args = append(args,
+			fmt.Sprintf("--oidc-issuer-url=%s", issuer.IssuerURL()),
+			fmt.Sprintf("--oidc-client-id=%s", s.OIDC.ClientID),
+			fmt.Sprintf("--oidc-username-claim=%s", issuer.opts.UsernameClaim),
+			fmt.Sprintf("--oidc-groups-claim=%s", issuer.opts.GroupsClaim),
+			fmt.Sprintf("--oidc-ca-file=%s", issuer.CACertPath()),
+		)
+	}
+
+	detectedStart := s.stdErr.Detect("Serving securely")
+	timedOut := time.After(s.StartTimeout)
+
+	command := exec.Command(s.Path, args...)
+	s.session, err = s.ProcessStarter(command, s.stdOut, s.stdErr)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case <-detectedStart:
+		return nil
+	case <-timedOut:
+		return fmt.Errorf("timeout waiting for apiserver to start serving")
+	}
+}
+
+func (s *APIServer) ensureInitialized() {
+	if s.Path == "" {
+		s.Path = DefaultBinPathFinder("kube-apiserver")
+	}
+
+	if s.AddressManager == nil {
+		s.AddressManager = &DefaultAddressManager{}
+	}
+	if s.ProcessStarter == nil {
+		s.ProcessStarter = func(command *exec.Cmd, out, err io.Writer) (SimpleSession, error) {
+			return gexec.Start(command, out, err)
+		}
+	}
+	if s.CertDirManager == nil {
+		s.CertDirManager = NewTempDirManager()
+	}
+	if s.StopTimeout == 0 {
+		s.StopTimeout = 20 * time.Second
+	}
+	if s.StartTimeout == 0 {
+		s.StartTimeout = 20 * time.Second
+	}
+
+	s.stdOut = gbytes.NewBuffer()
+	s.stdErr = gbytes.NewBuffer()
+}
+
+// Stop stops this process gracefully, waits for its termination, and cleans up the cert directory.
+func (s *APIServer) Stop() error {
+	if s.oidcIssuer != nil {
+		if err := s.oidcIssuer.Stop(); err != nil {
+			return err
+		}
+	}
+
+	if s.session == nil {
+		return nil
+	}
+
+	session := s.session.Terminate()
+	detectedStop := session.Exited
+	timedOut := time.After(s.StopTimeout)
+
+	select {
+	case <-detectedStop:
+		break
+	case <-timedOut:
+		return fmt.Errorf("timeout waiting for apiserver to stop")
+	}
+
+	return s.CertDirManager.Destroy()
+}
+
+// OIDC returns the in-process OIDC issuer securing this apiserver, if OIDCOptions was set before
+// Start.
+func (s *APIServer) OIDC() (OIDCIssuer, error) {
+	if s.oidcIssuer == nil {
+		return nil, fmt.Errorf("APIServer has no OIDC issuer: set OIDCOptions before calling Start")
+	}
+	return s.oidcIssuer, nil
+}
@@ -0,0 +1,113 @@
+package test
+
+import (
+	"fmt"
+
+	"k8s.io/client-go/rest"
+)
+
+// BootstrapperType selects which strategy a ControlPlane uses to bring up Etcd and the APIServer.
+type BootstrapperType string
+
+const (
+	// BootstrapperRaw starts a bare etcd and a bare kube-apiserver binary, wired directly together.
+	// This is the fastest path to a running control plane, but it never exercises bootstrap-token,
+	// CSR-signing, or kubelet-client-cert flows.
+	BootstrapperRaw BootstrapperType = "raw"
+
+	// BootstrapperKubeadm stages a minimal kubeadm config and runs `kubeadm init` against a locally
+	// started etcd, exercising the same bootstrap flows a real cluster goes through.
+	BootstrapperKubeadm BootstrapperType = "kubeadm"
+)
+
+// Bootstrapper knows how to bring up and tear down a control plane, and how to hand back
+// credentials a client can use to talk to it.
+type Bootstrapper interface {
+	Start() error
+	Stop() error
+	KubeConfig() (*rest.Config, error)
+	Name() string
+}
+
+//go:generate counterfeiter . Bootstrapper
+
+// newBootstrapper constructs the Bootstrapper for the given type. An unknown type returns an error
+// at NewControlPlane time rather than at Start time, so callers fail fast.
+func newBootstrapper(bootstrapperType BootstrapperType) (Bootstrapper, error) {
+	switch bootstrapperType {
+	case "", BootstrapperRaw:
+		return &rawBootstrapper{
+			Etcd:      &Etcd{},
+			APIServer: &APIServer{},
+		}, nil
+	case BootstrapperKubeadm:
+		return &kubeadmBootstrapper{
+			Etcd: &Etcd{},
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown bootstrapper type %q", bootstrapperType)
+	}
+}
+
+// rawBootstrapper wires a bare Etcd directly to a bare APIServer. This is the strategy the
+// ControlPlane used before Bootstrapper existed.
+type rawBootstrapper struct {
+	Etcd      *Etcd
+	APIServer *APIServer
+}
+
+// Name returns the name of this bootstrapper.
+func (b *rawBootstrapper) Name() string {
+	return string(BootstrapperRaw)
+}
+
+// Start starts etcd, then points the apiserver at it and starts that too.
+func (b *rawBootstrapper) Start() error {
+	if err := b.Etcd.Start(); err != nil {
+		return err
+	}
+
+	etcdURL, err := b.Etcd.URL()
+	if err != nil {
+		return err
+	}
+	b.APIServer.EtcdURL = etcdURL
+
+	return b.APIServer.Start()
+}
+
+// Stop stops the apiserver, then etcd.
+func (b *rawBootstrapper) Stop() error {
+	if err := b.APIServer.Stop(); err != nil {
+		return err
+	}
+	return b.Etcd.Stop()
+}
+
+// KubeConfig returns a rest.Config pointing at the bare apiserver. The apiserver generates its
+// own self-signed serving certificate under CertDirManager's directory, and no CA is handed out
+// alongside it, so clients built from this config skip verifying it — acceptable for a
+// throwaway, loopback-only test control plane, but never for anything that talks to a real
+// cluster.
+func (b *rawBootstrapper) KubeConfig() (*rest.Config, error) {
+	url, err := b.APIServer.URL()
+	if err != nil {
+		return nil, err
+	}
+	return &rest.Config{
+		Host:            url,
+		TLSClientConfig: rest.TLSClientConfig{Insecure: true},
+	}, nil
+}
+
+// SetOIDCOptions configures the raw bootstrapper's apiserver to authenticate via an in-process
+// OIDC issuer. It implements the optional oidcConfigurer interface ControlPlane looks for.
+func (b *rawBootstrapper) SetOIDCOptions(opts OIDCOptions) {
+	b.APIServer.OIDC = &opts
+}
+
+// OIDC returns the OIDC issuer securing the raw bootstrapper's apiserver. It implements the
+// optional oidcProvider interface ControlPlane looks for.
+func (b *rawBootstrapper) OIDC() (OIDCIssuer, error) {
+	return b.APIServer.OIDC()
+}
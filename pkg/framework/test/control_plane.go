@@ -1,11 +1,18 @@
 // Package test an integration test framework for k8s
 package test
 
+import (
+	"fmt"
+
+	"k8s.io/client-go/rest"
+)
+
 // ControlPlane is a struct that knows how to start your test control plane.
 //
-// Right now, that means Etcd and your APIServer. This is likely to increase in future.
+// Right now, that means Etcd and your APIServer, brought up by a Bootstrapper. This is likely to
+// increase in future.
 type ControlPlane struct {
-	APIServer ControlPlaneProcess
+	bootstrapper Bootstrapper
 }
 
 // ControlPlaneProcess knows how to start and stop a ControlPlane process.
@@ -19,24 +26,79 @@ type ControlPlaneProcess interface {
 
 //go:generate counterfeiter . ControlPlaneProcess
 
-// NewControlPlane will give you a ControlPlane struct that's properly wired together.
-func NewControlPlane() *ControlPlane {
-	return &ControlPlane{
-		APIServer: &APIServer{},
+// NewControlPlane will give you a ControlPlane struct that's properly wired together, using the
+// bootstrapping strategy named by the first of bootstrapperType. bootstrapperType is variadic so
+// that NewControlPlane() can be called with no argument; passing no argument, or "", is
+// equivalent to BootstrapperRaw. Passing more than one bootstrapperType is an error. The error is
+// returned as a second value on every path, the raw one included.
+func NewControlPlane(bootstrapperType ...BootstrapperType) (*ControlPlane, error) {
+	if len(bootstrapperType) > 1 {
+		return nil, fmt.Errorf("NewControlPlane accepts at most one BootstrapperType, got %d", len(bootstrapperType))
+	}
+
+	var selected BootstrapperType
+	if len(bootstrapperType) == 1 {
+		selected = bootstrapperType[0]
+	}
+
+	bootstrapper, err := newBootstrapper(selected)
+	if err != nil {
+		return nil, err
 	}
+	return &ControlPlane{bootstrapper: bootstrapper}, nil
 }
 
 // Start will start your control plane. To stop it, call Stop().
 func (f *ControlPlane) Start() error {
-	return f.APIServer.Start()
+	return f.bootstrapper.Start()
 }
 
 // Stop will stop your control plane, and clean up their data.
 func (f *ControlPlane) Stop() error {
-	return f.APIServer.Stop()
+	return f.bootstrapper.Stop()
+}
+
+// KubeConfig returns a rest.Config clients can use to connect to the control plane.
+func (f *ControlPlane) KubeConfig() (*rest.Config, error) {
+	return f.bootstrapper.KubeConfig()
 }
 
 // APIServerURL returns the URL to the APIServer. Clients can use this URL to connect to the APIServer.
 func (f *ControlPlane) APIServerURL() (string, error) {
-	return f.APIServer.URL()
+	cfg, err := f.KubeConfig()
+	if err != nil {
+		return "", err
+	}
+	return cfg.Host, nil
+}
+
+// oidcConfigurer is implemented by bootstrappers whose apiserver can authenticate via an
+// in-process OIDC issuer.
+type oidcConfigurer interface {
+	SetOIDCOptions(OIDCOptions)
+}
+
+// oidcProvider is implemented by bootstrappers that can hand back the OIDC issuer securing their
+// apiserver once SetOIDCOptions has been called.
+type oidcProvider interface {
+	OIDC() (OIDCIssuer, error)
+}
+
+// SetOIDCOptions configures the control plane's apiserver to authenticate requests via an
+// in-process OIDC issuer. It must be called before Start. Bootstrappers that don't support OIDC
+// ignore the call.
+func (f *ControlPlane) SetOIDCOptions(opts OIDCOptions) {
+	if configurer, ok := f.bootstrapper.(oidcConfigurer); ok {
+		configurer.SetOIDCOptions(opts)
+	}
+}
+
+// OIDC returns the in-process OIDC issuer securing this control plane's apiserver, set up via
+// SetOIDCOptions before Start.
+func (f *ControlPlane) OIDC() (OIDCIssuer, error) {
+	provider, ok := f.bootstrapper.(oidcProvider)
+	if !ok {
+		return nil, fmt.Errorf("%s bootstrapper does not support OIDC", f.bootstrapper.Name())
+	}
+	return provider.OIDC()
 }
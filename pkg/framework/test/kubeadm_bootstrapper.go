@@ -0,0 +1,223 @@
+package test
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/onsi/gomega/gbytes"
+	"github.com/onsi/gomega/gexec"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// kubeadmConfigTemplate is a minimal kubeadm.k8s.io/v1beta2 InitConfiguration+ClusterConfiguration
+// pair: just enough to point kubeadm at an already-running etcd and skip the pieces that don't
+// make sense for a single-binary test control plane.
+const kubeadmConfigTemplate = `apiVersion: kubeadm.k8s.io/v1beta2
+kind: InitConfiguration
+---
+apiVersion: kubeadm.k8s.io/v1beta2
+kind: ClusterConfiguration
+controlPlaneEndpoint: %s
+certificatesDir: %s
+networking:
+  podSubnet: %s
+etcd:
+  external:
+    endpoints:
+    - %s
+`
+
+// kubeadmBootstrapper runs a real `kubeadm init` against a locally started etcd, so tests can
+// exercise bootstrap-token, CSR-signing, and kubelet-client-cert flows that the raw bootstrapper
+// cannot.
+//
+// `kubeadm init` writes the control plane's static pod manifests to disk, then waits for a kubelet
+// to pick them up and bring the control plane to life before it reports success. Nothing else in
+// this package runs a kubelet, so this bootstrapper starts one itself: it skips kubeadm's own
+// kubelet-start phase (which would try to enable a systemd unit that doesn't exist in a test
+// environment) and wait-control-plane phase (which would otherwise block forever, since kubeadm
+// never started a kubelet of its own), spawns KubeletPath directly against the kubeconfig kubeadm
+// already wrote, and waits for that kubelet to report the node as registered instead.
+type kubeadmBootstrapper struct {
+	Etcd *Etcd
+
+	AddressManager AddressManager
+	Path           string
+	KubeletPath    string
+	ProcessStarter SimpleSessionStarter
+	DataDirManager DataDirManager
+	PodSubnet      string
+	StartTimeout   time.Duration
+
+	dataDir        string
+	adminConf      string
+	stdOut         *gbytes.Buffer
+	stdErr         *gbytes.Buffer
+	kubeletSession SimpleSession
+	kubeletStdOut  *gbytes.Buffer
+	kubeletStdErr  *gbytes.Buffer
+}
+
+// Name returns the name of this bootstrapper.
+func (b *kubeadmBootstrapper) Name() string {
+	return string(BootstrapperKubeadm)
+}
+
+// Start starts etcd, stages a kubeadm config pointing at it, runs `kubeadm init` against it, then
+// starts a kubelet so the control plane it initializes actually comes up.
+func (b *kubeadmBootstrapper) Start() error {
+	b.ensureInitialized()
+
+	if err := b.Etcd.Start(); err != nil {
+		return err
+	}
+	etcdURL, err := b.Etcd.URL()
+	if err != nil {
+		return err
+	}
+
+	port, host, err := b.AddressManager.Initialize()
+	if err != nil {
+		return err
+	}
+
+	dataDir, err := b.DataDirManager.Create()
+	if err != nil {
+		return err
+	}
+	b.dataDir = dataDir
+
+	certsDir := filepath.Join(dataDir, "pki")
+	endpoint := fmt.Sprintf("%s:%d", host, port)
+	config := fmt.Sprintf(kubeadmConfigTemplate, endpoint, certsDir, b.PodSubnet, etcdURL)
+
+	configPath := filepath.Join(dataDir, "kubeadm.yaml")
+	if err := ioutil.WriteFile(configPath, []byte(config), 0644); err != nil {
+		return err
+	}
+
+	args := []string{
+		"init",
+		fmt.Sprintf("--config=%s", configPath),
+		fmt.Sprintf("--kubeconfig-dir=%s", dataDir),
+		"--skip-phases=addon/kube-proxy,preflight,kubelet-start,wait-control-plane",
+	}
+
+	command := exec.Command(b.Path, args...)
+	initSession, err := b.ProcessStarter(command, b.stdOut, b.stdErr)
+	if err != nil {
+		return err
+	}
+
+	exitCode, err := waitForExit(initSession, b.StartTimeout)
+	if err != nil {
+		return fmt.Errorf("timeout waiting for kubeadm init to write the control plane manifests:\n%s", b.stdErr.Contents())
+	}
+	if exitCode != 0 {
+		return fmt.Errorf("kubeadm init exited with code %d:\n%s", exitCode, b.stdErr.Contents())
+	}
+
+	b.adminConf = filepath.Join(dataDir, "admin.conf")
+
+	detectedReady := b.kubeletStdErr.Detect("Successfully registered node")
+
+	kubeletCommand := exec.Command(b.KubeletPath,
+		fmt.Sprintf("--kubeconfig=%s", filepath.Join(dataDir, "kubelet.conf")),
+		"--pod-manifest-path=/etc/kubernetes/manifests",
+		fmt.Sprintf("--cert-dir=%s", certsDir),
+	)
+	b.kubeletSession, err = b.ProcessStarter(kubeletCommand, b.kubeletStdOut, b.kubeletStdErr)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case <-detectedReady:
+		return nil
+	case <-time.After(b.StartTimeout):
+		return fmt.Errorf("timeout waiting for kubelet to register the node:\n%s", b.kubeletStdErr.Contents())
+	}
+}
+
+// Stop stops the kubelet, etcd, and cleans up the staged kubeadm data directory.
+func (b *kubeadmBootstrapper) Stop() error {
+	if b.kubeletSession != nil {
+		select {
+		case <-b.kubeletSession.Terminate().Exited:
+		case <-time.After(b.StartTimeout):
+			return fmt.Errorf("timeout waiting for kubelet to stop:\n%s", b.kubeletStdErr.Contents())
+		}
+	}
+	if err := b.Etcd.Stop(); err != nil {
+		return err
+	}
+	if b.DataDirManager == nil {
+		return nil
+	}
+	return b.DataDirManager.Destroy()
+}
+
+// KubeConfig parses the admin.conf generated by `kubeadm init` and returns it as a rest.Config.
+func (b *kubeadmBootstrapper) KubeConfig() (*rest.Config, error) {
+	if b.adminConf == "" {
+		return nil, fmt.Errorf("kubeadm bootstrapper has not been started yet")
+	}
+	return clientcmd.BuildConfigFromFlags("", b.adminConf)
+}
+
+// waitForExit polls session until it has exited or timeout elapses. SimpleSession has no blocking
+// "wait for natural exit" method, only ExitCode (-1 until the process exits) and Terminate (which
+// sends it a signal) — so this polls rather than risk killing a process we want to let finish on
+// its own.
+func waitForExit(session SimpleSession, timeout time.Duration) (int, error) {
+	deadline := time.After(timeout)
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		if code := session.ExitCode(); code != -1 {
+			return code, nil
+		}
+		select {
+		case <-deadline:
+			return -1, fmt.Errorf("timeout waiting for process to exit")
+		case <-ticker.C:
+		}
+	}
+}
+
+func (b *kubeadmBootstrapper) ensureInitialized() {
+	if b.Path == "" {
+		b.Path = DefaultBinPathFinder("kubeadm")
+	}
+	if b.KubeletPath == "" {
+		b.KubeletPath = DefaultBinPathFinder("kubelet")
+	}
+	if b.AddressManager == nil {
+		b.AddressManager = &DefaultAddressManager{}
+	}
+	if b.ProcessStarter == nil {
+		b.ProcessStarter = func(command *exec.Cmd, out, err io.Writer) (SimpleSession, error) {
+			return gexec.Start(command, out, err)
+		}
+	}
+	if b.DataDirManager == nil {
+		b.DataDirManager = NewTempDirManager()
+	}
+	if b.PodSubnet == "" {
+		b.PodSubnet = "10.244.0.0/16"
+	}
+	if b.StartTimeout == 0 {
+		b.StartTimeout = 60 * time.Second
+	}
+
+	b.stdOut = gbytes.NewBuffer()
+	b.stdErr = gbytes.NewBuffer()
+	b.kubeletStdOut = gbytes.NewBuffer()
+	b.kubeletStdErr = gbytes.NewBuffer()
+}
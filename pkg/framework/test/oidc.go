@@ -0,0 +1,263 @@
+package test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// OIDCOptions configures an APIServer to authenticate requests against an in-process OIDC
+// issuer, instead of requiring an external identity provider.
+type OIDCOptions struct {
+	// ClientID is the audience tokens are minted for, and the value the apiserver is told to
+	// expect via --oidc-client-id.
+	ClientID string
+
+	// UsernameClaim is the JWT claim the apiserver maps to the Kubernetes username. Defaults to
+	// "sub".
+	UsernameClaim string
+
+	// GroupsClaim is the JWT claim the apiserver maps to the Kubernetes groups. Defaults to
+	// "groups".
+	GroupsClaim string
+
+	// AddressManager assigns the port the issuer listens on. Defaults to a DefaultAddressManager.
+	AddressManager AddressManager
+}
+
+// OIDCIssuer knows how to mint OIDC ID tokens and serve the discovery document and JWKS an
+// apiserver needs in order to validate them.
+type OIDCIssuer interface {
+	// IssuerURL is the value the apiserver was given via --oidc-issuer-url.
+	IssuerURL() string
+
+	// MintToken signs an RS256 JWT asserting subject and groups, plus any extraClaims, against
+	// the issuer's key. The result can be used as a bearer token against the apiserver.
+	MintToken(subject string, groups []string, extraClaims map[string]interface{}) (string, error)
+
+	// Stop shuts down the issuer's HTTPS listener.
+	Stop() error
+}
+
+// oidcIssuer is the concrete OIDCIssuer backing an APIServer's OIDCOptions. It serves the
+// discovery document and JWKS over HTTPS using a freshly generated, self-signed certificate, so
+// the apiserver can validate tokens via --oidc-ca-file without reaching out to a real IdP.
+type oidcIssuer struct {
+	opts       OIDCOptions
+	signingKey *rsa.PrivateKey
+	keyID      string
+	issuer     string
+	caCertPath string
+	server     *http.Server
+	listener   net.Listener
+}
+
+const oidcKeyID = "kinflate-test-oidc"
+
+// newOIDCIssuer generates a signing key and a self-signed TLS certificate, then starts serving
+// the discovery document and JWKS on an AddressManager-assigned port.
+func newOIDCIssuer(opts OIDCOptions) (*oidcIssuer, error) {
+	if opts.AddressManager == nil {
+		opts.AddressManager = &DefaultAddressManager{}
+	}
+	if opts.UsernameClaim == "" {
+		opts.UsernameClaim = "sub"
+	}
+	if opts.GroupsClaim == "" {
+		opts.GroupsClaim = "groups"
+	}
+
+	signingKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, fmt.Errorf("generating OIDC signing key: %v", err)
+	}
+
+	port, host, err := opts.AddressManager.Initialize()
+	if err != nil {
+		return nil, err
+	}
+
+	certPEM, keyPEM, err := generateSelfSignedCert(host)
+	if err != nil {
+		return nil, fmt.Errorf("generating OIDC issuer TLS certificate: %v", err)
+	}
+	caFile, err := ioutil.TempFile("", "oidc-issuer-ca-*.pem")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := caFile.Write(certPEM); err != nil {
+		return nil, err
+	}
+	if err := caFile.Close(); err != nil {
+		return nil, err
+	}
+
+	tlsCert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	issuer := &oidcIssuer{
+		opts:       opts,
+		signingKey: signingKey,
+		keyID:      oidcKeyID,
+		issuer:     fmt.Sprintf("https://%s:%d", host, port),
+		caCertPath: caFile.Name(),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", issuer.serveDiscovery)
+	mux.HandleFunc("/keys", issuer.serveJWKS)
+
+	listener, err := net.Listen("tcp", fmt.Sprintf("%s:%d", host, port))
+	if err != nil {
+		return nil, err
+	}
+	issuer.listener = listener
+	issuer.server = &http.Server{
+		Handler:   mux,
+		TLSConfig: &tls.Config{Certificates: []tls.Certificate{tlsCert}},
+	}
+
+	go issuer.server.ServeTLS(listener, "", "")
+
+	return issuer, nil
+}
+
+// IssuerURL returns the HTTPS URL the apiserver was, or will be, given via --oidc-issuer-url.
+func (o *oidcIssuer) IssuerURL() string {
+	return o.issuer
+}
+
+// CACertPath returns the path to the PEM-encoded certificate the apiserver should be given via
+// --oidc-ca-file in order to trust this issuer.
+func (o *oidcIssuer) CACertPath() string {
+	return o.caCertPath
+}
+
+// MintToken signs an RS256 JWT asserting subject and groups against the issuer's key.
+func (o *oidcIssuer) MintToken(subject string, groups []string, extraClaims map[string]interface{}) (string, error) {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":             o.issuer,
+		"aud":             o.opts.ClientID,
+		"sub":             subject,
+		o.opts.GroupsClaim: groups,
+		"iat":             now.Unix(),
+		"exp":             now.Add(time.Hour).Unix(),
+	}
+	claims[o.opts.UsernameClaim] = subject
+	for k, v := range extraClaims {
+		claims[k] = v
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = o.keyID
+	return token.SignedString(o.signingKey)
+}
+
+// Stop shuts down the issuer's HTTPS listener.
+func (o *oidcIssuer) Stop() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return o.server.Shutdown(ctx)
+}
+
+type oidcDiscoveryDocument struct {
+	Issuer                           string   `json:"issuer"`
+	JWKSURI                          string   `json:"jwks_uri"`
+	ResponseTypesSupported           []string `json:"response_types_supported"`
+	SubjectTypesSupported            []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported []string `json:"id_token_signing_alg_values_supported"`
+}
+
+func (o *oidcIssuer) serveDiscovery(w http.ResponseWriter, r *http.Request) {
+	doc := oidcDiscoveryDocument{
+		Issuer:                           o.issuer,
+		JWKSURI:                          o.issuer + "/keys",
+		ResponseTypesSupported:           []string{"id_token"},
+		SubjectTypesSupported:            []string{"public"},
+		IDTokenSigningAlgValuesSupported: []string{"RS256"},
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(doc)
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+type jsonWebKeySet struct {
+	Keys []jsonWebKey `json:"keys"`
+}
+
+func (o *oidcIssuer) serveJWKS(w http.ResponseWriter, r *http.Request) {
+	pub := o.signingKey.PublicKey
+	set := jsonWebKeySet{Keys: []jsonWebKey{{
+		Kty: "RSA",
+		Use: "sig",
+		Kid: o.keyID,
+		Alg: "RS256",
+		N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+	}}}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(set)
+}
+
+// generateSelfSignedCert creates a self-signed certificate valid for host and marked as its own
+// CA, so the issuer's HTTPS listener can be trusted by handing its cert to --oidc-ca-file directly.
+func generateSelfSignedCert(host string) (certPEM, keyPEM []byte, err error) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	template := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: host},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		DNSNames:              []string{host},
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		template.IPAddresses = []net.IP{ip}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &priv.PublicKey, priv)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(priv)})
+	return certPEM, keyPEM, nil
+}
@@ -0,0 +1,74 @@
+package test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"testing"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+func TestGenerateSelfSignedCertIsParseable(t *testing.T) {
+	certPEM, keyPEM, err := generateSelfSignedCert("127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(certPEM) == 0 || len(keyPEM) == 0 {
+		t.Fatal("expected non-empty cert and key PEM")
+	}
+	if _, err := tls.X509KeyPair(certPEM, keyPEM); err != nil {
+		t.Fatalf("expected cert and key PEM to parse as a key pair: %v", err)
+	}
+}
+
+func TestOIDCIssuerMintTokenSetsExpectedClaims(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issuer := &oidcIssuer{
+		opts: OIDCOptions{
+			ClientID:      "my-client",
+			UsernameClaim: "email",
+			GroupsClaim:   "groups",
+		},
+		issuer:     "https://127.0.0.1:12345",
+		keyID:      oidcKeyID,
+		signingKey: key,
+	}
+
+	tokenString, err := issuer.MintToken("alice@example.com", []string{"admins", "devs"}, map[string]interface{}{"extra": "value"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		return &key.PublicKey, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		t.Fatalf("expected jwt.MapClaims, got %T", token.Claims)
+	}
+
+	if claims["iss"] != issuer.issuer {
+		t.Errorf("iss = %v, want %v", claims["iss"], issuer.issuer)
+	}
+	if claims["aud"] != "my-client" {
+		t.Errorf("aud = %v, want my-client", claims["aud"])
+	}
+	if claims["sub"] != "alice@example.com" {
+		t.Errorf("sub = %v, want alice@example.com", claims["sub"])
+	}
+	if claims["email"] != "alice@example.com" {
+		t.Errorf("email claim = %v, want alice@example.com", claims["email"])
+	}
+	if claims["extra"] != "value" {
+		t.Errorf("extra = %v, want value", claims["extra"])
+	}
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kinflate
+
+import (
+	"fmt"
+	"path"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	manifest "k8s.io/kubectl/pkg/apis/manifest/v1alpha1"
+)
+
+// LoadForCluster is LoadBaseAndOverlayPkg for a single cluster target: it layers that cluster's
+// patches on top of the overlay's own, and folds the cluster's objectLabels over the overlay's.
+// The caller applies the returned Manifest the same way it would the plain overlay one, then
+// calls ApplyClusterOverrides on the rendered objects to stamp the cluster's namespace and drop
+// anything its resourceFilter excludes.
+func LoadForCluster(dir, clusterName string) ([]string, []string, *manifest.Manifest, error) {
+	baseFiles, overlayFiles, overlayPkg, err := loadBaseAndOverlayPkg(dir)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	cluster, err := findClusterTarget(overlayPkg, clusterName)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	for _, p := range cluster.Patches {
+		overlayFiles = append(overlayFiles, path.Join(dir, p))
+	}
+
+	clusterPkg := *overlayPkg
+	clusterPkg.ObjectLabels = mergeStringMaps(overlayPkg.ObjectLabels, cluster.ObjectLabels)
+
+	return baseFiles, overlayFiles, &clusterPkg, nil
+}
+
+// ApplyClusterOverrides stamps cluster's namespace onto every object that passes its
+// resourceFilter, and drops the objects that don't. It is meant to run after updateMetadata, so
+// the namespace and resourceFilter see the same NamePrefix'd, labeled objects every other
+// consumer of the overlay does.
+func ApplyClusterOverrides(objs []*unstructured.Unstructured, cluster *manifest.ClusterTarget) []*unstructured.Unstructured {
+	kept := make([]*unstructured.Unstructured, 0, len(objs))
+	for _, obj := range objs {
+		if !matchesResourceFilter(obj, cluster.ResourceFilter) {
+			continue
+		}
+		if cluster.Namespace != "" {
+			obj.SetNamespace(cluster.Namespace)
+		}
+		kept = append(kept, obj)
+	}
+	return kept
+}
+
+func findClusterTarget(overlayPkg *manifest.Manifest, name string) (*manifest.ClusterTarget, error) {
+	for i := range overlayPkg.Clusters {
+		if overlayPkg.Clusters[i].Name == name {
+			return &overlayPkg.Clusters[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no cluster target named %q declared in %s", name, kubeManifestFileName)
+}
+
+func matchesResourceFilter(obj *unstructured.Unstructured, filter *manifest.ResourceFilter) bool {
+	if filter == nil {
+		return true
+	}
+
+	if len(filter.GroupVersionKinds) > 0 {
+		gvk := obj.GetAPIVersion() + "/" + obj.GetKind()
+		found := false
+		for _, want := range filter.GroupVersionKinds {
+			if want == gvk {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if len(filter.MatchLabels) > 0 {
+		labels := obj.GetLabels()
+		for k, v := range filter.MatchLabels {
+			if labels[k] != v {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func mergeStringMaps(base, overrides map[string]string) map[string]string {
+	merged := map[string]string{}
+	for k, v := range base {
+		merged[k] = v
+	}
+	for k, v := range overrides {
+		merged[k] = v
+	}
+	return merged
+}
@@ -0,0 +1,195 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kinflate
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	manifest "k8s.io/kubectl/pkg/apis/manifest/v1alpha1"
+)
+
+// writeClusterFixture lays out a base + overlay directory pair on disk, the overlay declaring a
+// "prod" cluster target, and returns the overlay directory for LoadForCluster to load.
+func writeClusterFixture(t *testing.T) string {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "kinflate-cluster-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	baseDir := filepath.Join(dir, "base")
+	if err := os.Mkdir(baseDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(baseDir, kubeManifestFileName), []byte(`
+resources:
+- deployment.yaml
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(baseDir, "deployment.yaml"), []byte("kind: Deployment\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "overlay-patch.yaml"), []byte("kind: Deployment\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "prod-patch.yaml"), []byte("kind: Deployment\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, kubeManifestFileName), []byte(`
+resources:
+- base
+patches:
+- overlay-patch.yaml
+objectLabels:
+  team: payments
+clusters:
+- name: prod
+  namespace: prod-ns
+  patches:
+  - prod-patch.yaml
+  objectLabels:
+    env: prod
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return dir
+}
+
+func TestLoadForClusterLayersPatchesAndMergesObjectLabels(t *testing.T) {
+	dir := writeClusterFixture(t)
+
+	baseFiles, overlayFiles, clusterPkg, err := LoadForCluster(dir, "prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantBaseFiles := []string{path.Join(dir, "base", "deployment.yaml")}
+	if len(baseFiles) != 1 || baseFiles[0] != wantBaseFiles[0] {
+		t.Errorf("baseFiles = %v, want %v", baseFiles, wantBaseFiles)
+	}
+
+	wantOverlayFiles := []string{
+		path.Join(dir, "overlay-patch.yaml"),
+		path.Join(dir, "prod-patch.yaml"),
+	}
+	if len(overlayFiles) != len(wantOverlayFiles) {
+		t.Fatalf("overlayFiles = %v, want %v", overlayFiles, wantOverlayFiles)
+	}
+	for i, want := range wantOverlayFiles {
+		if overlayFiles[i] != want {
+			t.Errorf("overlayFiles[%d] = %q, want the cluster's patches layered after the overlay's own: %q", i, overlayFiles[i], want)
+		}
+	}
+
+	wantLabels := map[string]string{"team": "payments", "env": "prod"}
+	for k, v := range wantLabels {
+		if clusterPkg.ObjectLabels[k] != v {
+			t.Errorf("clusterPkg.ObjectLabels[%q] = %q, want %q (ObjectLabels = %v)", k, clusterPkg.ObjectLabels[k], v, clusterPkg.ObjectLabels)
+		}
+	}
+}
+
+func TestLoadForClusterUnknownClusterNameErrors(t *testing.T) {
+	dir := writeClusterFixture(t)
+
+	if _, _, _, err := LoadForCluster(dir, "does-not-exist"); err == nil {
+		t.Errorf("expected an error for a cluster name not declared in the overlay's Kube-manifest.yaml")
+	}
+}
+
+func TestFindClusterTarget(t *testing.T) {
+	pkg := &manifest.Manifest{
+		Clusters: []manifest.ClusterTarget{
+			{Name: "staging"},
+			{Name: "prod", Namespace: "prod-ns"},
+		},
+	}
+
+	cluster, err := findClusterTarget(pkg, "prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cluster.Namespace != "prod-ns" {
+		t.Errorf("Namespace = %q, want prod-ns", cluster.Namespace)
+	}
+
+	if _, err := findClusterTarget(pkg, "dr"); err == nil {
+		t.Errorf("expected an error for an undeclared cluster target")
+	}
+}
+
+func TestApplyClusterOverridesFiltersAndNamespaces(t *testing.T) {
+	cluster := &manifest.ClusterTarget{
+		Namespace: "prod-ns",
+		ResourceFilter: &manifest.ResourceFilter{
+			GroupVersionKinds: []string{"apps/v1/Deployment"},
+		},
+	}
+
+	deployment := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]interface{}{"name": "web"},
+	}}
+	configMap := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": "app-config"},
+	}}
+
+	kept := ApplyClusterOverrides([]*unstructured.Unstructured{deployment, configMap}, cluster)
+
+	if len(kept) != 1 {
+		t.Fatalf("expected exactly 1 object to survive the filter, got %d", len(kept))
+	}
+	if kept[0].GetKind() != "Deployment" {
+		t.Errorf("expected the surviving object to be the Deployment, got %q", kept[0].GetKind())
+	}
+	if kept[0].GetNamespace() != "prod-ns" {
+		t.Errorf("namespace = %q, want prod-ns", kept[0].GetNamespace())
+	}
+}
+
+func TestMatchesResourceFilterMatchLabels(t *testing.T) {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata": map[string]interface{}{
+			"name":   "app-config",
+			"labels": map[string]interface{}{"tier": "frontend"},
+		},
+	}}
+
+	if !matchesResourceFilter(obj, &manifest.ResourceFilter{MatchLabels: map[string]string{"tier": "frontend"}}) {
+		t.Errorf("expected object with matching label to pass the filter")
+	}
+	if matchesResourceFilter(obj, &manifest.ResourceFilter{MatchLabels: map[string]string{"tier": "backend"}}) {
+		t.Errorf("expected object with non-matching label to fail the filter")
+	}
+}
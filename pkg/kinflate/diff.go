@@ -0,0 +1,527 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kinflate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"gopkg.in/yaml.v2"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/kubectl/pkg/apis/manifest/v1alpha1"
+)
+
+// serverManagedFields are metadata the apiserver fills in that never comes from a manifest, so
+// they're stripped from the live object before it's compared against the rendered one.
+var serverManagedFields = []string{
+	"resourceVersion", "uid", "generation", "creationTimestamp", "managedFields", "selfLink",
+}
+
+// DiffStatus classifies how a rendered object compares to its live counterpart.
+type DiffStatus string
+
+const (
+	// DiffAdded means the object doesn't exist live yet; applying dir would create it.
+	DiffAdded DiffStatus = "added"
+	// DiffChanged means the object exists live but differs from the rendered one.
+	DiffChanged DiffStatus = "changed"
+	// DiffRemoved means the object exists live, carries this overlay's ObjectLabels, but is no
+	// longer rendered; applying dir with prune semantics would delete it.
+	DiffRemoved DiffStatus = "removed"
+	// DiffUnchanged means the live object already matches the rendered one.
+	DiffUnchanged DiffStatus = "unchanged"
+)
+
+// DiffOptions controls how Diff compares rendered objects against their live counterparts.
+type DiffOptions struct {
+	// IgnorePaths are dotted, JSONPath-ish field paths (e.g. "spec.replicas") dropped from both
+	// sides before comparing.
+	IgnorePaths []string
+
+	// OmitDefaults compares the live object against the rendered one as returned by
+	// applySchemeDefaults (decoded into its registered Go type, run through
+	// clientgoscheme.Scheme's defaulting, and re-encoded), instead of against the rendered object
+	// as written. The live object itself is not changed beyond the usual stripping.
+	OmitDefaults bool
+}
+
+// ObjectDiff describes how one rendered object compares to its live counterpart.
+type ObjectDiff struct {
+	GroupVersionKind string
+	Namespace        string
+	Name             string
+	Status           DiffStatus
+	Diff             string
+}
+
+// DiffReport summarizes a Diff run across every object rendered from an overlay directory.
+type DiffReport struct {
+	Objects []ObjectDiff
+	Added   int
+	Changed int
+	Removed int
+}
+
+// Diff renders dir's overlay, fetches each rendered object's live counterpart from the cluster
+// cfg points at, and reports what applying dir would actually change. The rendered objects are
+// the base resources after updateMetadata and the generators; the overlay's patches are not
+// applied to them.
+func Diff(dir string, cfg *rest.Config, opts DiffOptions) (DiffReport, error) {
+	rendered, overlayPkg, err := renderObjectsForDiff(dir)
+	if err != nil {
+		return DiffReport{}, err
+	}
+
+	mapper, err := newRESTMapper(cfg)
+	if err != nil {
+		return DiffReport{}, err
+	}
+	dynClient, err := dynamic.NewForConfig(cfg)
+	if err != nil {
+		return DiffReport{}, err
+	}
+
+	var report DiffReport
+	renderedKeys := map[resourceKey]bool{}
+
+	for _, obj := range rendered {
+		key := resourceKeyFor(obj)
+		renderedKeys[key] = true
+
+		live, err := fetchLive(dynClient, mapper, obj)
+		if err != nil {
+			return DiffReport{}, err
+		}
+
+		objDiff, err := compareObjects(obj, live, opts)
+		if err != nil {
+			return DiffReport{}, err
+		}
+		report.Objects = append(report.Objects, objDiff)
+	}
+
+	removed, err := findRemoved(dynClient, mapper, rendered, overlayPkg.ObjectLabels, renderedKeys)
+	if err != nil {
+		return DiffReport{}, err
+	}
+	report.Objects = append(report.Objects, removed...)
+
+	for _, objDiff := range report.Objects {
+		switch objDiff.Status {
+		case DiffAdded:
+			report.Added++
+		case DiffChanged:
+			report.Changed++
+		case DiffRemoved:
+			report.Removed++
+		}
+	}
+
+	return report, nil
+}
+
+// resourceKey identifies an object well enough to match a rendered object against a live one.
+type resourceKey struct {
+	gvk       string
+	namespace string
+	name      string
+}
+
+func resourceKeyFor(obj *unstructured.Unstructured) resourceKey {
+	return resourceKey{
+		gvk:       obj.GetAPIVersion() + "/" + obj.GetKind(),
+		namespace: obj.GetNamespace(),
+		name:      obj.GetName(),
+	}
+}
+
+// renderObjectsForDiff loads dir's base resources and runs them through the same
+// updateMetadata + generator pipeline every other consumer of the overlay sees.
+func renderObjectsForDiff(dir string) ([]*unstructured.Unstructured, *v1alpha1.Manifest, error) {
+	baseFiles, _, overlayPkg, err := loadBaseAndOverlayPkg(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var objs []*unstructured.Unstructured
+	for _, f := range baseFiles {
+		fileObjs, err := readManifestObjects(f)
+		if err != nil {
+			return nil, nil, err
+		}
+		objs = append(objs, fileObjs...)
+	}
+
+	for _, obj := range objs {
+		if err := applyUpdateMetadata(obj, overlayPkg); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	objs, err = GenerateAndRewrite(dir, overlayPkg, objs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return objs, overlayPkg, nil
+}
+
+// applyUpdateMetadata round-trips obj through updateMetadata, which works in terms of raw bytes.
+func applyUpdateMetadata(obj *unstructured.Unstructured, overlayPkg *v1alpha1.Manifest) error {
+	jsonBytes, err := obj.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	updated, err := updateMetadata(jsonBytes, overlayPkg)
+	if err != nil {
+		return err
+	}
+	asJSON, err := yamlDocToJSON(updated)
+	if err != nil {
+		return err
+	}
+	// updateMetadata yaml-marshals the *unstructured.Unstructured it decodes, which nests the
+	// object's fields under the struct's "object" key.
+	var wrapped struct {
+		Object json.RawMessage `json:"object"`
+	}
+	if err := json.Unmarshal(asJSON, &wrapped); err != nil {
+		return err
+	}
+	return obj.UnmarshalJSON(wrapped.Object)
+}
+
+// readManifestObjects reads a base resource file, which may contain more than one YAML document
+// separated by "---", and decodes each into an *unstructured.Unstructured.
+func readManifestObjects(path string) ([]*unstructured.Unstructured, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var objs []*unstructured.Unstructured
+	for _, doc := range strings.Split(string(content), "\n---") {
+		if strings.TrimSpace(doc) == "" {
+			continue
+		}
+		jsonBytes, err := yamlDocToJSON([]byte(doc))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		obj := &unstructured.Unstructured{}
+		if err := obj.UnmarshalJSON(jsonBytes); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		objs = append(objs, obj)
+	}
+	return objs, nil
+}
+
+// yamlDocToJSON converts a single YAML document into JSON, the form unstructured.Unstructured
+// works with.
+func yamlDocToJSON(doc []byte) ([]byte, error) {
+	var raw interface{}
+	if err := yaml.Unmarshal(doc, &raw); err != nil {
+		return nil, err
+	}
+	return json.Marshal(convertYAMLMapKeys(raw))
+}
+
+// convertYAMLMapKeys converts the map[interface{}]interface{} values gopkg.in/yaml.v2 produces
+// into map[string]interface{}, which encoding/json (and unstructured.Unstructured) require.
+func convertYAMLMapKeys(in interface{}) interface{} {
+	switch v := in.(type) {
+	case map[interface{}]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			out[fmt.Sprintf("%v", key)] = convertYAMLMapKeys(value)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, value := range v {
+			out[i] = convertYAMLMapKeys(value)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// newRESTMapper builds a discovery-backed RESTMapper from cfg, so Diff can turn a rendered
+// object's GroupVersionKind into the GroupVersionResource its REST API is served under.
+func newRESTMapper(cfg *rest.Config) (*restmapper.DeferredDiscoveryRESTMapper, error) {
+	disco, err := discovery.NewDiscoveryClientForConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	cached := memoryCachedDiscoveryClient{DiscoveryInterface: disco}
+	return restmapper.NewDeferredDiscoveryRESTMapper(cached), nil
+}
+
+// memoryCachedDiscoveryClient adapts a plain discovery.DiscoveryInterface to the
+// discovery.CachedDiscoveryInterface restmapper.NewDeferredDiscoveryRESTMapper requires, without
+// actually caching anything to disk.
+type memoryCachedDiscoveryClient struct {
+	discovery.DiscoveryInterface
+}
+
+func (memoryCachedDiscoveryClient) Fresh() bool { return true }
+func (memoryCachedDiscoveryClient) Invalidate() {}
+
+func fetchLive(dynClient dynamic.Interface, mapper *restmapper.DeferredDiscoveryRESTMapper, obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	gvk := obj.GroupVersionKind()
+	mapping, err := mapper.RESTMapping(schema.GroupKind{Group: gvk.Group, Kind: gvk.Kind}, gvk.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	var resourceClient dynamic.ResourceInterface
+	if mapping.Scope.Name() == "namespace" {
+		resourceClient = dynClient.Resource(mapping.Resource).Namespace(obj.GetNamespace())
+	} else {
+		resourceClient = dynClient.Resource(mapping.Resource)
+	}
+
+	live, err := resourceClient.Get(context.TODO(), obj.GetName(), metav1.GetOptions{})
+	if err != nil {
+		if isNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return live, nil
+}
+
+// findRemoved lists live objects carrying ownerLabels for every GVK+namespace Diff rendered, and
+// reports the ones that weren't rendered as removed. With no ownerLabels, removed-object
+// detection is skipped: there'd be no safe way to tell "ours" apart from everything else in the
+// namespace.
+func findRemoved(dynClient dynamic.Interface, mapper *restmapper.DeferredDiscoveryRESTMapper, rendered []*unstructured.Unstructured, ownerLabels map[string]string, renderedKeys map[resourceKey]bool) ([]ObjectDiff, error) {
+	if len(ownerLabels) == 0 {
+		return nil, nil
+	}
+
+	type group struct {
+		gvk       schema.GroupVersionKind
+		namespace string
+	}
+	seen := map[group]bool{}
+
+	var diffs []ObjectDiff
+	for _, obj := range rendered {
+		g := group{gvk: obj.GroupVersionKind(), namespace: obj.GetNamespace()}
+		if seen[g] {
+			continue
+		}
+		seen[g] = true
+
+		mapping, err := mapper.RESTMapping(schema.GroupKind{Group: g.gvk.Group, Kind: g.gvk.Kind}, g.gvk.Version)
+		if err != nil {
+			return nil, err
+		}
+
+		var resourceClient dynamic.ResourceInterface
+		if mapping.Scope.Name() == "namespace" {
+			resourceClient = dynClient.Resource(mapping.Resource).Namespace(g.namespace)
+		} else {
+			resourceClient = dynClient.Resource(mapping.Resource)
+		}
+
+		list, err := resourceClient.List(context.TODO(), metav1.ListOptions{LabelSelector: labelsSelectorString(ownerLabels)})
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range list.Items {
+			live := &list.Items[i]
+			key := resourceKey{gvk: live.GetAPIVersion() + "/" + live.GetKind(), namespace: live.GetNamespace(), name: live.GetName()}
+			if renderedKeys[key] {
+				continue
+			}
+			diffs = append(diffs, ObjectDiff{
+				GroupVersionKind: key.gvk,
+				Namespace:        key.namespace,
+				Name:             key.name,
+				Status:           DiffRemoved,
+			})
+		}
+	}
+
+	return diffs, nil
+}
+
+func labelsSelectorString(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf("%s=%s", k, labels[k]))
+	}
+	return strings.Join(parts, ",")
+}
+
+// compareObjects diffs rendered against live, after stripping server-managed fields, applying
+// opts.IgnorePaths, and (if requested) omitting defaulted fields.
+func compareObjects(rendered, live *unstructured.Unstructured, opts DiffOptions) (ObjectDiff, error) {
+	objDiff := ObjectDiff{
+		GroupVersionKind: rendered.GetAPIVersion() + "/" + rendered.GetKind(),
+		Namespace:        rendered.GetNamespace(),
+		Name:             rendered.GetName(),
+	}
+
+	if live == nil {
+		objDiff.Status = DiffAdded
+		return objDiff, nil
+	}
+
+	liveCopy := live.DeepCopy()
+	stripServerManagedFields(liveCopy)
+
+	renderedForCompare := rendered
+	if opts.OmitDefaults {
+		defaulted, err := applySchemeDefaults(rendered)
+		if err != nil {
+			return ObjectDiff{}, err
+		}
+		renderedForCompare = defaulted
+	}
+
+	for _, p := range opts.IgnorePaths {
+		removePath(liveCopy.Object, strings.Split(p, "."))
+		removePath(renderedForCompare.Object, strings.Split(p, "."))
+	}
+
+	renderedYAML, err := yaml.Marshal(renderedForCompare.Object)
+	if err != nil {
+		return ObjectDiff{}, err
+	}
+	liveYAML, err := yaml.Marshal(liveCopy.Object)
+	if err != nil {
+		return ObjectDiff{}, err
+	}
+
+	if string(renderedYAML) == string(liveYAML) {
+		objDiff.Status = DiffUnchanged
+		return objDiff, nil
+	}
+
+	unified, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(liveYAML)),
+		B:        difflib.SplitLines(string(renderedYAML)),
+		FromFile: "live",
+		ToFile:   "rendered",
+		Context:  3,
+	})
+	if err != nil {
+		return ObjectDiff{}, err
+	}
+
+	objDiff.Status = DiffChanged
+	objDiff.Diff = unified
+	return objDiff, nil
+}
+
+func stripServerManagedFields(obj *unstructured.Unstructured) {
+	delete(obj.Object, "status")
+	metadata, ok := obj.Object["metadata"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	for _, field := range serverManagedFields {
+		delete(metadata, field)
+	}
+}
+
+// applySchemeDefaults decodes rendered through its registered Go type in scheme.Scheme, runs the
+// type's normal defaulting functions, and re-encodes the result back to unstructured. The result
+// is what the apiserver would have produced from rendered before persisting it, so diffing
+// against it (instead of against rendered as written) keeps fields the apiserver only filled in
+// with a real, type-specific default from showing up as noise — without guessing at what counts
+// as a "default" from the shape of the value alone.
+//
+// If rendered's GroupVersionKind isn't registered with scheme.Scheme (a CRD, say), rendered is
+// returned unchanged: there's no defaulting function to apply.
+func applySchemeDefaults(rendered *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	gvk := rendered.GroupVersionKind()
+	typed, err := clientgoscheme.Scheme.New(gvk)
+	if err != nil {
+		return rendered, nil
+	}
+
+	jsonBytes, err := rendered.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(jsonBytes, typed); err != nil {
+		return nil, err
+	}
+
+	clientgoscheme.Scheme.Default(typed)
+
+	m, err := runtime.DefaultUnstructuredConverter.ToUnstructured(typed)
+	if err != nil {
+		return nil, err
+	}
+	defaulted := &unstructured.Unstructured{Object: m}
+	defaulted.SetGroupVersionKind(gvk)
+	return defaulted, nil
+}
+
+func removePath(obj map[string]interface{}, path []string) {
+	if len(path) == 0 || obj == nil {
+		return
+	}
+	if len(path) == 1 {
+		delete(obj, path[0])
+		return
+	}
+	next, ok := obj[path[0]].(map[string]interface{})
+	if !ok {
+		return
+	}
+	removePath(next, path[1:])
+}
+
+func isNotFound(err error) bool {
+	type statusError interface {
+		Status() metav1.Status
+	}
+	se, ok := err.(statusError)
+	if !ok {
+		return false
+	}
+	return se.Status().Reason == metav1.StatusReasonNotFound
+}
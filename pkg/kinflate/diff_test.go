@@ -0,0 +1,204 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kinflate
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestCompareObjectsAdded(t *testing.T) {
+	rendered := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1", "kind": "ConfigMap",
+		"metadata": map[string]interface{}{"name": "app-config"},
+	}}
+
+	objDiff, err := compareObjects(rendered, nil, DiffOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if objDiff.Status != DiffAdded {
+		t.Errorf("Status = %q, want %q", objDiff.Status, DiffAdded)
+	}
+}
+
+func TestCompareObjectsUnchangedAfterStrippingServerFields(t *testing.T) {
+	rendered := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1", "kind": "ConfigMap",
+		"metadata": map[string]interface{}{"name": "app-config"},
+		"data":      map[string]interface{}{"color": "blue"},
+	}}
+	live := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1", "kind": "ConfigMap",
+		"metadata": map[string]interface{}{
+			"name":            "app-config",
+			"resourceVersion": "12345",
+			"uid":             "abc-123",
+		},
+		"data": map[string]interface{}{"color": "blue"},
+	}}
+
+	objDiff, err := compareObjects(rendered, live, DiffOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if objDiff.Status != DiffUnchanged {
+		t.Errorf("Status = %q, want %q (diff: %s)", objDiff.Status, DiffUnchanged, objDiff.Diff)
+	}
+}
+
+func TestCompareObjectsChanged(t *testing.T) {
+	rendered := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1", "kind": "ConfigMap",
+		"metadata": map[string]interface{}{"name": "app-config"},
+		"data":      map[string]interface{}{"color": "green"},
+	}}
+	live := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1", "kind": "ConfigMap",
+		"metadata": map[string]interface{}{"name": "app-config"},
+		"data":      map[string]interface{}{"color": "blue"},
+	}}
+
+	objDiff, err := compareObjects(rendered, live, DiffOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if objDiff.Status != DiffChanged {
+		t.Errorf("Status = %q, want %q", objDiff.Status, DiffChanged)
+	}
+	if objDiff.Diff == "" {
+		t.Errorf("expected a non-empty unified diff for a changed object")
+	}
+}
+
+func TestCompareObjectsIgnorePaths(t *testing.T) {
+	rendered := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1", "kind": "Deployment",
+		"metadata": map[string]interface{}{"name": "web"},
+		"spec":      map[string]interface{}{"replicas": int64(3)},
+	}}
+	live := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1", "kind": "Deployment",
+		"metadata": map[string]interface{}{"name": "web"},
+		"spec":      map[string]interface{}{"replicas": int64(5)},
+	}}
+
+	objDiff, err := compareObjects(rendered, live, DiffOptions{IgnorePaths: []string{"spec.replicas"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if objDiff.Status != DiffUnchanged {
+		t.Errorf("Status = %q, want %q once spec.replicas is ignored (diff: %s)", objDiff.Status, DiffUnchanged, objDiff.Diff)
+	}
+}
+
+func deploymentFixture(name string, specExtra map[string]interface{}) *unstructured.Unstructured {
+	spec := map[string]interface{}{
+		"selector": map[string]interface{}{
+			"matchLabels": map[string]interface{}{"app": name},
+		},
+		"template": map[string]interface{}{
+			"metadata": map[string]interface{}{"labels": map[string]interface{}{"app": name}},
+			"spec": map[string]interface{}{
+				"containers": []interface{}{
+					map[string]interface{}{"name": "app", "image": "example.com/app:v1"},
+				},
+			},
+		},
+	}
+	for k, v := range specExtra {
+		spec[k] = v
+	}
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1", "kind": "Deployment",
+		"metadata": map[string]interface{}{"name": name},
+		"spec":      spec,
+	}}
+}
+
+func TestCompareObjectsOmitDefaultsIgnoresApiserverDefaultedField(t *testing.T) {
+	// rendered leaves spec.replicas unset; the apiserver's own defaulting fills it in as 1.
+	rendered := deploymentFixture("web", nil)
+	live := deploymentFixture("web", map[string]interface{}{"replicas": int64(1)})
+
+	objDiff, err := compareObjects(rendered, live, DiffOptions{OmitDefaults: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if objDiff.Status != DiffUnchanged {
+		t.Errorf("Status = %q, want %q once apiserver-defaulted replicas is accounted for (diff: %s)", objDiff.Status, DiffUnchanged, objDiff.Diff)
+	}
+}
+
+func TestCompareObjectsOmitDefaultsStillCatchesOutOfBandScaling(t *testing.T) {
+	// rendered leaves spec.replicas unset (apiserver would default it to 1), but the live
+	// object was scaled to 0 out-of-band. That's real drift, not a default, and OmitDefaults
+	// must not hide it.
+	rendered := deploymentFixture("web", nil)
+	live := deploymentFixture("web", map[string]interface{}{"replicas": int64(0)})
+
+	objDiff, err := compareObjects(rendered, live, DiffOptions{OmitDefaults: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if objDiff.Status != DiffChanged {
+		t.Errorf("Status = %q, want %q: out-of-band scale-to-zero must not be mistaken for a default", objDiff.Status, DiffChanged)
+	}
+}
+
+func TestApplySchemeDefaultsLeavesUnregisteredGVKUnchanged(t *testing.T) {
+	rendered := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "example.com/v1", "kind": "Widget",
+		"metadata": map[string]interface{}{"name": "thingy"},
+	}}
+
+	defaulted, err := applySchemeDefaults(rendered)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if defaulted != rendered {
+		t.Errorf("expected an unregistered GVK to be returned unchanged")
+	}
+}
+
+func TestLabelsSelectorStringIsSortedAndDeterministic(t *testing.T) {
+	got := labelsSelectorString(map[string]string{"b": "2", "a": "1"})
+	want := "a=1,b=2"
+	if got != want {
+		t.Errorf("labelsSelectorString = %q, want %q", got, want)
+	}
+}
+
+func TestConvertYAMLMapKeys(t *testing.T) {
+	in := map[interface{}]interface{}{
+		"name": "app-config",
+		"data": map[interface{}]interface{}{"color": "blue"},
+	}
+
+	out, ok := convertYAMLMapKeys(in).(map[string]interface{})
+	if !ok {
+		t.Fatalf("expected a map[string]interface{}, got %T", convertYAMLMapKeys(in))
+	}
+	data, ok := out["data"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("expected nested map to convert too, got %T", out["data"])
+	}
+	if data["color"] != "blue" {
+		t.Errorf("data[color] = %v, want blue", data["color"])
+	}
+}
@@ -0,0 +1,260 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kinflate
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	manifest "k8s.io/kubectl/pkg/apis/manifest/v1alpha1"
+)
+
+// GenerateAndRewrite materializes overlayPkg's secretGenerators and configMapGenerators rooted at
+// dir, rewrites every reference to them found across objs to point at the generated objects'
+// hashed names, and returns objs with the generated Secrets and ConfigMaps appended. It is meant
+// to run right after updateMetadata, so the generated objects pick up the same NamePrefix,
+// ObjectLabels, and ObjectAnnotations as everything else emitted for this overlay.
+func GenerateAndRewrite(dir string, overlayPkg *manifest.Manifest, objs []*unstructured.Unstructured) ([]*unstructured.Unstructured, error) {
+	secrets, configMaps, secretNames, configMapNames, err := generateSecretsAndConfigMaps(dir, overlayPkg)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, obj := range objs {
+		rewriteGeneratorReferences(obj, secretNames, configMapNames)
+	}
+
+	for _, secret := range secrets {
+		u, err := toUnstructured(secret)
+		if err != nil {
+			return nil, err
+		}
+		objs = append(objs, u)
+	}
+	for _, configMap := range configMaps {
+		u, err := toUnstructured(configMap)
+		if err != nil {
+			return nil, err
+		}
+		objs = append(objs, u)
+	}
+
+	return objs, nil
+}
+
+// toUnstructured converts a typed API object into an *unstructured.Unstructured, the
+// representation the rest of the emit pipeline works with.
+func toUnstructured(obj interface{}) (*unstructured.Unstructured, error) {
+	m, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	return &unstructured.Unstructured{Object: m}, nil
+}
+
+// generatedNames maps a generator's declared name (before namePrefix and the content hash are
+// applied) to the hashed name it was actually given.
+type generatedNames map[string]string
+
+// copyStringMapOrNil returns an independent copy of m, or nil if m is empty. Generated objects
+// each need their own labels/annotations map rather than sharing overlayPkg's, so that nothing
+// downstream that mutates one generated object's map affects another's or overlayPkg's own.
+func copyStringMapOrNil(m map[string]string) map[string]string {
+	if len(m) == 0 {
+		return nil
+	}
+	return mergeStringMaps(nil, m)
+}
+
+// generateSecretsAndConfigMaps turns overlayPkg's secretGenerators and configMapGenerators into
+// fully-formed Secret and ConfigMap objects, resolving file and env-file sources relative to dir.
+// It returns the generated objects alongside the name mappings later used to rewrite references
+// to them, keyed separately because a Secret and a ConfigMap are allowed to share a generator name.
+func generateSecretsAndConfigMaps(dir string, overlayPkg *manifest.Manifest) ([]*corev1.Secret, []*corev1.ConfigMap, generatedNames, generatedNames, error) {
+	secretNames := generatedNames{}
+	configMapNames := generatedNames{}
+
+	secrets := make([]*corev1.Secret, 0, len(overlayPkg.SecretGenerators))
+	for _, gen := range overlayPkg.SecretGenerators {
+		data, err := loadGeneratorData(dir, gen.GeneratorArgs)
+		if err != nil {
+			return nil, nil, nil, nil, fmt.Errorf("secretGenerator %q: %v", gen.Name, err)
+		}
+
+		secretType := corev1.SecretType(gen.Type)
+		if secretType == "" {
+			secretType = corev1.SecretTypeOpaque
+		}
+
+		hashedName := overlayPkg.NamePrefix + gen.Name + "-" + hashSuffix(data)
+		binData := make(map[string][]byte, len(data))
+		for k, v := range data {
+			binData[k] = []byte(v)
+		}
+
+		secrets = append(secrets, &corev1.Secret{
+			TypeMeta: metav1.TypeMeta{
+				APIVersion: "v1",
+				Kind:       "Secret",
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        hashedName,
+				Labels:      copyStringMapOrNil(overlayPkg.ObjectLabels),
+				Annotations: copyStringMapOrNil(overlayPkg.ObjectAnnotations),
+			},
+			Type: secretType,
+			Data: binData,
+		})
+		secretNames[gen.Name] = hashedName
+	}
+
+	configMaps := make([]*corev1.ConfigMap, 0, len(overlayPkg.ConfigMapGenerators))
+	for _, gen := range overlayPkg.ConfigMapGenerators {
+		data, err := loadGeneratorData(dir, gen.GeneratorArgs)
+		if err != nil {
+			return nil, nil, nil, nil, fmt.Errorf("configMapGenerator %q: %v", gen.Name, err)
+		}
+
+		hashedName := overlayPkg.NamePrefix + gen.Name + "-" + hashSuffix(data)
+
+		configMaps = append(configMaps, &corev1.ConfigMap{
+			TypeMeta: metav1.TypeMeta{
+				APIVersion: "v1",
+				Kind:       "ConfigMap",
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        hashedName,
+				Labels:      copyStringMapOrNil(overlayPkg.ObjectLabels),
+				Annotations: copyStringMapOrNil(overlayPkg.ObjectAnnotations),
+			},
+			Data: data,
+		})
+		configMapNames[gen.Name] = hashedName
+	}
+
+	return secrets, configMaps, secretNames, configMapNames, nil
+}
+
+// hashSuffix computes a short, stable suffix for a generator's data: an FNV-1a hash of the
+// data map (sorted by key, so the result doesn't depend on map iteration order), base32-encoded
+// and truncated to 8 characters.
+func hashSuffix(data map[string]string) string {
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	h := fnv.New64a()
+	for _, k := range keys {
+		fmt.Fprintf(h, "%s=%s\n", k, data[k])
+	}
+
+	sum := make([]byte, 8)
+	binary.BigEndian.PutUint64(sum, h.Sum64())
+
+	encoded := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(sum)
+	return strings.ToLower(encoded[:8])
+}
+
+// loadGeneratorData resolves a generator's files, envFiles, and literals (in that order, each
+// able to overwrite keys set by the previous source) into a single data map, relative to dir.
+func loadGeneratorData(dir string, args manifest.GeneratorArgs) (map[string]string, error) {
+	data := map[string]string{}
+
+	for _, source := range args.FileSources {
+		key, filePath := parseFileSource(source)
+		content, err := ioutil.ReadFile(path.Join(dir, filePath))
+		if err != nil {
+			return nil, err
+		}
+		if key == "" {
+			key = filepath.Base(filePath)
+		}
+		data[key] = string(content)
+	}
+
+	for _, envFile := range args.EnvFileSources {
+		content, err := ioutil.ReadFile(path.Join(dir, envFile))
+		if err != nil {
+			return nil, err
+		}
+		if err := parseEnvFile(content, data); err != nil {
+			return nil, fmt.Errorf("envFile %q: %v", envFile, err)
+		}
+	}
+
+	for _, literal := range args.LiteralSources {
+		k, v, err := parseLiteralSource(literal)
+		if err != nil {
+			return nil, err
+		}
+		data[k] = v
+	}
+
+	return data, nil
+}
+
+// parseFileSource splits a `files:` entry of the form `key=path` into its key and path. An entry
+// with no `=` has no explicit key; the caller derives one from the file's base name.
+func parseFileSource(source string) (key, filePath string) {
+	if i := strings.Index(source, "="); i >= 0 {
+		return source[:i], source[i+1:]
+	}
+	return "", source
+}
+
+// parseLiteralSource splits a `literals:` entry of the form `key=value`.
+func parseLiteralSource(source string) (key, value string, err error) {
+	i := strings.Index(source, "=")
+	if i < 0 {
+		return "", "", fmt.Errorf("literal %q is not of the form key=value", source)
+	}
+	return source[:i], source[i+1:], nil
+}
+
+// parseEnvFile reads `KEY=VALUE` pairs, one per line, into data. Blank lines and lines starting
+// with `#` are ignored.
+func parseEnvFile(content []byte, data map[string]string) error {
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		k, v, err := parseLiteralSource(line)
+		if err != nil {
+			return err
+		}
+		data[k] = v
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,236 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kinflate
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	manifest "k8s.io/kubectl/pkg/apis/manifest/v1alpha1"
+)
+
+func TestHashSuffixIsStableAndOrderIndependent(t *testing.T) {
+	a := map[string]string{"foo": "bar", "baz": "qux"}
+	b := map[string]string{"baz": "qux", "foo": "bar"}
+
+	if hashSuffix(a) != hashSuffix(b) {
+		t.Errorf("hashSuffix should not depend on map iteration order")
+	}
+
+	if len(hashSuffix(a)) != 8 {
+		t.Errorf("expected an 8 character hash, got %q", hashSuffix(a))
+	}
+
+	changed := map[string]string{"foo": "bar", "baz": "quux"}
+	if hashSuffix(a) == hashSuffix(changed) {
+		t.Errorf("hashSuffix should change when data changes")
+	}
+}
+
+func TestGenerateSecretsAndConfigMapsAppliesNamePrefix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kinflate-generators-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "app.properties"), []byte("color=blue"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	pkg := &manifest.Manifest{
+		NamePrefix: "prod-",
+		SecretGenerators: []manifest.SecretGenerator{
+			{GeneratorArgs: manifest.GeneratorArgs{Name: "creds", LiteralSources: []string{"user=admin"}}},
+		},
+		ConfigMapGenerators: []manifest.ConfigMapGenerator{
+			{GeneratorArgs: manifest.GeneratorArgs{Name: "app-config", FileSources: []string{"app.properties"}}},
+		},
+	}
+
+	secrets, configMaps, secretNames, configMapNames, err := generateSecretsAndConfigMaps(dir, pkg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(secrets) != 1 || len(configMaps) != 1 {
+		t.Fatalf("expected exactly one secret and one configmap, got %d secrets and %d configmaps", len(secrets), len(configMaps))
+	}
+
+	wantSecretName := secretNames["creds"]
+	if secrets[0].Name != wantSecretName {
+		t.Errorf("secret name %q does not match recorded mapping %q", secrets[0].Name, wantSecretName)
+	}
+	if secrets[0].Name[:len("prod-creds-")] != "prod-creds-" {
+		t.Errorf("expected secret name to start with %q, got %q", "prod-creds-", secrets[0].Name)
+	}
+	if string(secrets[0].Data["user"]) != "admin" {
+		t.Errorf("expected secret data[user]=admin, got %q", secrets[0].Data["user"])
+	}
+
+	wantConfigMapName := configMapNames["app-config"]
+	if configMaps[0].Name != wantConfigMapName {
+		t.Errorf("configmap name %q does not match recorded mapping %q", configMaps[0].Name, wantConfigMapName)
+	}
+	if configMaps[0].Data["app.properties"] != "color=blue" {
+		t.Errorf("expected configmap data[app.properties]=color=blue, got %q", configMaps[0].Data["app.properties"])
+	}
+}
+
+func TestGenerateSecretsAndConfigMapsAppliesObjectLabelsAndAnnotations(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kinflate-generators-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	pkg := &manifest.Manifest{
+		ObjectLabels:      map[string]string{"team": "payments"},
+		ObjectAnnotations: map[string]string{"managed-by": "kinflate"},
+		SecretGenerators: []manifest.SecretGenerator{
+			{GeneratorArgs: manifest.GeneratorArgs{Name: "creds", LiteralSources: []string{"user=admin"}}},
+		},
+		ConfigMapGenerators: []manifest.ConfigMapGenerator{
+			{GeneratorArgs: manifest.GeneratorArgs{Name: "app-config", LiteralSources: []string{"color=blue"}}},
+		},
+	}
+
+	secrets, configMaps, _, _, err := generateSecretsAndConfigMaps(dir, pkg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if secrets[0].Labels["team"] != "payments" || secrets[0].Annotations["managed-by"] != "kinflate" {
+		t.Errorf("expected generated secret to carry overlayPkg's ObjectLabels/ObjectAnnotations, got labels=%v annotations=%v", secrets[0].Labels, secrets[0].Annotations)
+	}
+	if configMaps[0].Labels["team"] != "payments" || configMaps[0].Annotations["managed-by"] != "kinflate" {
+		t.Errorf("expected generated configmap to carry overlayPkg's ObjectLabels/ObjectAnnotations, got labels=%v annotations=%v", configMaps[0].Labels, configMaps[0].Annotations)
+	}
+
+	pkg.ObjectLabels["team"] = "mutated-after-generation"
+	if secrets[0].Labels["team"] != "payments" {
+		t.Errorf("expected generated secret's labels to be independent of overlayPkg's map, got %v", secrets[0].Labels)
+	}
+}
+
+func TestGenerateSecretsAndConfigMapsIsDeterministic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kinflate-generators-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	pkg := &manifest.Manifest{
+		ConfigMapGenerators: []manifest.ConfigMapGenerator{
+			{GeneratorArgs: manifest.GeneratorArgs{Name: "app-config", LiteralSources: []string{"a=1", "b=2"}}},
+		},
+	}
+
+	_, first, _, _, err := generateSecretsAndConfigMaps(dir, pkg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, second, _, _, err := generateSecretsAndConfigMaps(dir, pkg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if first[0].Name != second[0].Name {
+		t.Errorf("expected the same generator to produce the same hashed name every time, got %q and %q", first[0].Name, second[0].Name)
+	}
+}
+
+// TestGenerateAndRewriteEndToEnd proves the hash-then-rewrite pipeline actually composes: the
+// hashed name GenerateAndRewrite attaches to the emitted Secret/ConfigMap must be exactly the
+// name it rewrites every reference to point at, not just something generateSecretsAndConfigMaps
+// and rewriteGeneratorReferences each separately agree with in isolation.
+func TestGenerateAndRewriteEndToEnd(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kinflate-generate-and-rewrite-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "app.properties"), []byte("color=blue"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	pkg := &manifest.Manifest{
+		NamePrefix: "prod-",
+		SecretGenerators: []manifest.SecretGenerator{
+			{GeneratorArgs: manifest.GeneratorArgs{Name: "creds", LiteralSources: []string{"user=admin"}}},
+		},
+		ConfigMapGenerators: []manifest.ConfigMapGenerator{
+			{GeneratorArgs: manifest.GeneratorArgs{Name: "app-config", FileSources: []string{"app.properties"}}},
+		},
+	}
+
+	deployment := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]interface{}{"name": "web"},
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"containers": []interface{}{
+						map[string]interface{}{
+							"name": "app",
+							"envFrom": []interface{}{
+								map[string]interface{}{"secretRef": map[string]interface{}{"name": "creds"}},
+								map[string]interface{}{"configMapRef": map[string]interface{}{"name": "app-config"}},
+							},
+						},
+					},
+				},
+			},
+		},
+	}}
+
+	objs, err := GenerateAndRewrite(dir, pkg, []*unstructured.Unstructured{deployment})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var secretName, configMapName string
+	for _, obj := range objs {
+		switch obj.GetKind() {
+		case "Secret":
+			secretName = obj.GetName()
+		case "ConfigMap":
+			configMapName = obj.GetName()
+		}
+	}
+	if secretName == "" || configMapName == "" {
+		t.Fatalf("expected a generated Secret and ConfigMap among the returned objects, got %+v", objs)
+	}
+
+	container := deployment.Object["spec"].(map[string]interface{})["template"].(map[string]interface{})["spec"].(map[string]interface{})["containers"].([]interface{})[0].(map[string]interface{})
+	envFrom := container["envFrom"].([]interface{})
+
+	gotSecretRef := envFrom[0].(map[string]interface{})["secretRef"].(map[string]interface{})["name"]
+	if gotSecretRef != secretName {
+		t.Errorf("deployment's secretRef.name = %v, want the emitted Secret's actual name %q", gotSecretRef, secretName)
+	}
+
+	gotConfigMapRef := envFrom[1].(map[string]interface{})["configMapRef"].(map[string]interface{})["name"]
+	if gotConfigMapRef != configMapName {
+		t.Errorf("deployment's configMapRef.name = %v, want the emitted ConfigMap's actual name %q", gotConfigMapRef, configMapName)
+	}
+}
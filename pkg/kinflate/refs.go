@@ -0,0 +1,146 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kinflate
+
+import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// rewriteGeneratorReferences rewrites obj's references to generated Secrets and ConfigMaps
+// (keyed by their un-suffixed generator name) to point at the hashed names those generators
+// were actually given. It mutates obj in place.
+func rewriteGeneratorReferences(obj *unstructured.Unstructured, secretNames, configMapNames generatedNames) {
+	if obj == nil {
+		return
+	}
+
+	var podSpec map[string]interface{}
+	switch obj.GetKind() {
+	case "Pod":
+		podSpec = nestedMap(obj.Object, "spec")
+	case "CronJob":
+		podSpec = nestedMap(obj.Object, "spec", "jobTemplate", "spec", "template", "spec")
+	default:
+		// Deployment, StatefulSet, DaemonSet, Job, ReplicaSet, ReplicationController all keep
+		// their PodSpec at spec.template.spec.
+		podSpec = nestedMap(obj.Object, "spec", "template", "spec")
+	}
+
+	rewritePodSpecRefs(podSpec, secretNames, configMapNames)
+}
+
+// nestedMap walks obj following path, returning the map[string]interface{} found there, or nil
+// if any step along the way is missing or not itself a map. Unlike unstructured.NestedMap, this
+// does not deep-copy, so mutations through the returned map are reflected back in obj.
+func nestedMap(obj map[string]interface{}, path ...string) map[string]interface{} {
+	cur := obj
+	for _, p := range path {
+		if cur == nil {
+			return nil
+		}
+		next, ok := cur[p].(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		cur = next
+	}
+	return cur
+}
+
+func rewritePodSpecRefs(podSpec map[string]interface{}, secretNames, configMapNames generatedNames) {
+	if podSpec == nil {
+		return
+	}
+
+	for _, containersKey := range []string{"containers", "initContainers"} {
+		containers, _ := podSpec[containersKey].([]interface{})
+		for _, c := range containers {
+			container, ok := c.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			rewriteEnvRefs(container, secretNames, configMapNames)
+			rewriteEnvFromRefs(container, secretNames, configMapNames)
+		}
+	}
+
+	rewriteVolumeRefs(podSpec, secretNames, configMapNames)
+}
+
+func rewriteEnvRefs(container map[string]interface{}, secretNames, configMapNames generatedNames) {
+	env, _ := container["env"].([]interface{})
+	for _, e := range env {
+		entry, ok := e.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		valueFrom, ok := entry["valueFrom"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		rewriteRefName(valueFrom, "secretKeyRef", secretNames)
+		rewriteRefName(valueFrom, "configMapKeyRef", configMapNames)
+	}
+}
+
+func rewriteEnvFromRefs(container map[string]interface{}, secretNames, configMapNames generatedNames) {
+	envFrom, _ := container["envFrom"].([]interface{})
+	for _, e := range envFrom {
+		entry, ok := e.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		rewriteRefName(entry, "secretRef", secretNames)
+		rewriteRefName(entry, "configMapRef", configMapNames)
+	}
+}
+
+func rewriteVolumeRefs(podSpec map[string]interface{}, secretNames, configMapNames generatedNames) {
+	volumes, _ := podSpec["volumes"].([]interface{})
+	for _, v := range volumes {
+		volume, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if secretVolume, ok := volume["secret"].(map[string]interface{}); ok {
+			rewriteRefField(secretVolume, "secretName", secretNames)
+		}
+		if configMapVolume, ok := volume["configMap"].(map[string]interface{}); ok {
+			rewriteRefField(configMapVolume, "name", configMapNames)
+		}
+	}
+}
+
+// rewriteRefName rewrites parent[key].name if parent[key] is a ref object naming one of names.
+func rewriteRefName(parent map[string]interface{}, key string, names generatedNames) {
+	ref, ok := parent[key].(map[string]interface{})
+	if !ok {
+		return
+	}
+	rewriteRefField(ref, "name", names)
+}
+
+// rewriteRefField rewrites obj[field] in place if its current value is a key in names.
+func rewriteRefField(obj map[string]interface{}, field string, names generatedNames) {
+	name, ok := obj[field].(string)
+	if !ok {
+		return
+	}
+	if hashed, found := names[name]; found {
+		obj[field] = hashed
+	}
+}
@@ -0,0 +1,172 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kinflate
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func podSpecFixture() map[string]interface{} {
+	return map[string]interface{}{
+		"containers": []interface{}{
+			map[string]interface{}{
+				"name": "app",
+				"env": []interface{}{
+					map[string]interface{}{
+						"name": "DB_PASSWORD",
+						"valueFrom": map[string]interface{}{
+							"secretKeyRef": map[string]interface{}{"name": "creds", "key": "password"},
+						},
+					},
+					map[string]interface{}{
+						"name": "COLOR",
+						"valueFrom": map[string]interface{}{
+							"configMapKeyRef": map[string]interface{}{"name": "app-config", "key": "color"},
+						},
+					},
+				},
+				"envFrom": []interface{}{
+					map[string]interface{}{"secretRef": map[string]interface{}{"name": "creds"}},
+					map[string]interface{}{"configMapRef": map[string]interface{}{"name": "app-config"}},
+				},
+			},
+		},
+		"volumes": []interface{}{
+			map[string]interface{}{
+				"name":   "creds-vol",
+				"secret": map[string]interface{}{"secretName": "creds"},
+			},
+			map[string]interface{}{
+				"name":      "config-vol",
+				"configMap": map[string]interface{}{"name": "app-config"},
+			},
+		},
+	}
+}
+
+func assertRewritten(t *testing.T, podSpec map[string]interface{}) {
+	t.Helper()
+
+	containers := podSpec["containers"].([]interface{})
+	container := containers[0].(map[string]interface{})
+	env := container["env"].([]interface{})
+
+	secretKeyRef := env[0].(map[string]interface{})["valueFrom"].(map[string]interface{})["secretKeyRef"].(map[string]interface{})
+	if got := secretKeyRef["name"]; got != "prod-creds-hash1" {
+		t.Errorf("secretKeyRef.name = %v, want prod-creds-hash1", got)
+	}
+
+	configMapKeyRef := env[1].(map[string]interface{})["valueFrom"].(map[string]interface{})["configMapKeyRef"].(map[string]interface{})
+	if got := configMapKeyRef["name"]; got != "prod-app-config-hash2" {
+		t.Errorf("configMapKeyRef.name = %v, want prod-app-config-hash2", got)
+	}
+
+	envFrom := container["envFrom"].([]interface{})
+	if got := envFrom[0].(map[string]interface{})["secretRef"].(map[string]interface{})["name"]; got != "prod-creds-hash1" {
+		t.Errorf("secretRef.name = %v, want prod-creds-hash1", got)
+	}
+	if got := envFrom[1].(map[string]interface{})["configMapRef"].(map[string]interface{})["name"]; got != "prod-app-config-hash2" {
+		t.Errorf("configMapRef.name = %v, want prod-app-config-hash2", got)
+	}
+
+	volumes := podSpec["volumes"].([]interface{})
+	if got := volumes[0].(map[string]interface{})["secret"].(map[string]interface{})["secretName"]; got != "prod-creds-hash1" {
+		t.Errorf("volumes[0].secret.secretName = %v, want prod-creds-hash1", got)
+	}
+	if got := volumes[1].(map[string]interface{})["configMap"].(map[string]interface{})["name"]; got != "prod-app-config-hash2" {
+		t.Errorf("volumes[1].configMap.name = %v, want prod-app-config-hash2", got)
+	}
+}
+
+func TestRewriteGeneratorReferencesAcrossWorkloadKinds(t *testing.T) {
+	secretNames := generatedNames{"creds": "prod-creds-hash1"}
+	configMapNames := generatedNames{"app-config": "prod-app-config-hash2"}
+
+	tests := []struct {
+		kind   string
+		object func() *unstructured.Unstructured
+		spec   func(obj *unstructured.Unstructured) map[string]interface{}
+	}{
+		{
+			kind: "Deployment",
+			object: func() *unstructured.Unstructured {
+				return &unstructured.Unstructured{Object: map[string]interface{}{
+					"kind": "Deployment",
+					"spec": map[string]interface{}{"template": map[string]interface{}{"spec": podSpecFixture()}},
+				}}
+			},
+		},
+		{kind: "StatefulSet"},
+		{kind: "DaemonSet"},
+		{kind: "Job"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.kind, func(t *testing.T) {
+			obj := &unstructured.Unstructured{Object: map[string]interface{}{
+				"kind": tc.kind,
+				"spec": map[string]interface{}{"template": map[string]interface{}{"spec": podSpecFixture()}},
+			}}
+
+			rewriteGeneratorReferences(obj, secretNames, configMapNames)
+
+			podSpec := obj.Object["spec"].(map[string]interface{})["template"].(map[string]interface{})["spec"].(map[string]interface{})
+			assertRewritten(t, podSpec)
+		})
+	}
+}
+
+func TestRewriteGeneratorReferencesForCronJob(t *testing.T) {
+	secretNames := generatedNames{"creds": "prod-creds-hash1"}
+	configMapNames := generatedNames{"app-config": "prod-app-config-hash2"}
+
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"kind": "CronJob",
+		"spec": map[string]interface{}{
+			"jobTemplate": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"template": map[string]interface{}{"spec": podSpecFixture()},
+				},
+			},
+		},
+	}}
+
+	rewriteGeneratorReferences(obj, secretNames, configMapNames)
+
+	podSpec := obj.Object["spec"].(map[string]interface{})["jobTemplate"].(map[string]interface{})["spec"].(map[string]interface{})["template"].(map[string]interface{})["spec"].(map[string]interface{})
+	assertRewritten(t, podSpec)
+}
+
+func TestRewriteGeneratorReferencesLeavesUnknownNamesAlone(t *testing.T) {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"kind": "Deployment",
+		"spec": map[string]interface{}{"template": map[string]interface{}{"spec": podSpecFixture()}},
+	}}
+
+	rewriteGeneratorReferences(obj, generatedNames{}, generatedNames{})
+
+	podSpec := obj.Object["spec"].(map[string]interface{})["template"].(map[string]interface{})["spec"].(map[string]interface{})
+	container := podSpec["containers"].([]interface{})[0].(map[string]interface{})
+	env := container["env"].([]interface{})
+	secretKeyRef := env[0].(map[string]interface{})["valueFrom"].(map[string]interface{})["secretKeyRef"].(map[string]interface{})
+
+	if got := secretKeyRef["name"]; got != "creds" {
+		t.Errorf("expected unknown ref to be left alone, got %v", got)
+	}
+}